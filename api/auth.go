@@ -0,0 +1,161 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/emicklei/go-restful"
+)
+
+// Scope identifies an operation that a bearer token may be restricted to.
+type Scope string
+
+const (
+	ScopePlan    Scope = "plan"
+	ScopeApply   Scope = "apply"
+	ScopeDestroy Scope = "destroy"
+	ScopeRefresh Scope = "refresh"
+
+	// ScopeRead authorizes read-only access to job status and logs,
+	// independent of which operation a job ran.
+	ScopeRead Scope = "read"
+)
+
+// authToken is a single bearer token loaded from the auth token file. Only
+// the SHA256 hash of the token is kept in memory.
+type authToken struct {
+	hash   [sha256.Size]byte
+	scopes map[Scope]bool
+}
+
+// AuthStore holds the bearer tokens accepted by the API server and the
+// scopes each one grants. It is safe for concurrent use, and may be
+// reloaded in place in response to a SIGHUP.
+type AuthStore struct {
+	mu     sync.RWMutex
+	tokens []authToken
+}
+
+// NewAuthStore loads the token file at path and returns an AuthStore
+// populated from it.
+func NewAuthStore(path string) (*AuthStore, error) {
+	s := &AuthStore{}
+	if err := s.Reload(path); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload re-reads the token file at path, atomically replacing the
+// current set of tokens. Each line has the form
+// "<token>[:<scope>[,<scope>...]]"; a line with no scopes is granted
+// every scope. Blank lines and lines beginning with "#" are ignored.
+func (s *AuthStore) Reload(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read auth token file: %s", err)
+	}
+
+	var tokens []authToken
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		t := authToken{
+			hash:   sha256.Sum256([]byte(parts[0])),
+			scopes: make(map[Scope]bool),
+		}
+
+		if len(parts) == 1 {
+			t.scopes[ScopePlan] = true
+			t.scopes[ScopeApply] = true
+			t.scopes[ScopeDestroy] = true
+			t.scopes[ScopeRefresh] = true
+			t.scopes[ScopeRead] = true
+		} else {
+			for _, raw := range strings.Split(parts[1], ",") {
+				t.scopes[Scope(strings.TrimSpace(raw))] = true
+			}
+		}
+
+		tokens = append(tokens, t)
+	}
+
+	s.mu.Lock()
+	s.tokens = tokens
+	s.mu.Unlock()
+	return nil
+}
+
+// Authorize reports whether token is known to the store and permitted to
+// use scope. Token comparison is constant-time to avoid leaking timing
+// information about valid tokens.
+func (s *AuthStore) Authorize(token string, scope Scope) bool {
+	hash := sha256.Sum256([]byte(token))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare(hash[:], t.hash[:]) == 1 {
+			return t.scopes[scope]
+		}
+	}
+	return false
+}
+
+// scopeFilter returns a go-restful filter that requires a valid bearer
+// token authorized for scope before letting the request reach its route.
+// If the command has no AuthStore configured, authentication is skipped
+// entirely so the server keeps working unauthenticated on 127.0.0.1.
+func (c *ApiCommand) scopeFilter(scope Scope) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		if c.authStore == nil {
+			chain.ProcessFilter(req, resp)
+			return
+		}
+
+		auth := req.Request.Header.Get("Authorization")
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if token == "" || token == auth {
+			resp.WriteErrorString(http.StatusUnauthorized, "Missing bearer token")
+			return
+		}
+
+		if !c.authStore.Authorize(token, scope) {
+			resp.WriteErrorString(http.StatusForbidden, "Token is not authorized for this operation")
+			return
+		}
+
+		chain.ProcessFilter(req, resp)
+	}
+}
+
+// jobOperationScopeFilter authorizes DELETE /jobs/{id} (cancel) using the
+// scope that was actually required to submit the job, recorded on the
+// Job itself, so a token can only cancel jobs it could have started
+// itself. Notably this is not always Scope derived from job.Operation:
+// an "apply" job submitted via DELETE /apply (destroy) required
+// ScopeDestroy, not ScopeApply.
+func (c *ApiCommand) jobOperationScopeFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	if c.authStore == nil {
+		chain.ProcessFilter(req, resp)
+		return
+	}
+
+	job, ok := c.jobs.Get(req.PathParameter("id"))
+	if !ok {
+		resp.WriteErrorString(http.StatusNotFound, "Unknown job")
+		return
+	}
+
+	c.scopeFilter(job.Scope)(req, resp, chain)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTokenFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "auth-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "tokens")
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	return path
+}
+
+func TestAuthStoreAuthorize(t *testing.T) {
+	path := writeTokenFile(t, `
+# comment line, ignored
+
+all-scopes-token
+plan-only-token:plan
+multi-scope-token:apply,refresh
+read-only-token:read
+`)
+
+	store, err := NewAuthStore(path)
+	if err != nil {
+		t.Fatalf("NewAuthStore: %s", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		scope Scope
+		want  bool
+	}{
+		{"unknown token is rejected", "no-such-token", ScopeApply, false},
+		{"token with no scopes is granted apply", "all-scopes-token", ScopeApply, true},
+		{"token with no scopes is granted read", "all-scopes-token", ScopeRead, true},
+		{"plan-only token is granted plan", "plan-only-token", ScopePlan, true},
+		{"plan-only token is denied apply", "plan-only-token", ScopeApply, false},
+		{"multi-scope token is granted apply", "multi-scope-token", ScopeApply, true},
+		{"multi-scope token is granted refresh", "multi-scope-token", ScopeRefresh, true},
+		{"multi-scope token is denied destroy", "multi-scope-token", ScopeDestroy, false},
+		{"read-only token is granted read", "read-only-token", ScopeRead, true},
+		{"read-only token is denied plan", "read-only-token", ScopePlan, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := store.Authorize(tt.token, tt.scope); got != tt.want {
+				t.Errorf("Authorize(%q, %q) = %v, want %v", tt.token, tt.scope, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthStoreReload(t *testing.T) {
+	path := writeTokenFile(t, "original-token:plan\n")
+
+	store, err := NewAuthStore(path)
+	if err != nil {
+		t.Fatalf("NewAuthStore: %s", err)
+	}
+	if !store.Authorize("original-token", ScopePlan) {
+		t.Fatal("expected original-token to be authorized for plan before reload")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("replacement-token:apply\n"), 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := store.Reload(path); err != nil {
+		t.Fatalf("Reload: %s", err)
+	}
+
+	if store.Authorize("original-token", ScopePlan) {
+		t.Error("expected original-token to no longer be authorized after reload")
+	}
+	if !store.Authorize("replacement-token", ScopeApply) {
+		t.Error("expected replacement-token to be authorized for apply after reload")
+	}
+}
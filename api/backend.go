@@ -0,0 +1,56 @@
+package api
+
+import "fmt"
+
+// ErrLocked is returned by StateBackend.Lock when the workspace is
+// already held by another caller whose lease has not yet expired.
+var ErrLocked = fmt.Errorf("workspace is locked")
+
+// StateBackend loads and saves Terraform state per workspace on behalf
+// of the API server, so callers no longer have to post the full state
+// blob with every request and race each other updating it.
+type StateBackend interface {
+	// Load returns the current state for workspace. A nil slice with a
+	// nil error means no state has been saved yet.
+	Load(workspace string) ([]byte, error)
+
+	// Save persists state for workspace.
+	Save(workspace string, state []byte) error
+
+	// Lock acquires an exclusive, leased lock on workspace and returns an
+	// id that must be presented to Unlock. It returns ErrLocked if the
+	// workspace is already locked and that lock's lease has not expired.
+	Lock(workspace string) (id string, err error)
+
+	// Unlock releases a lock previously returned by Lock. id must match
+	// the lock currently held for workspace.
+	Unlock(workspace, id string) error
+
+	// Renew extends the lease on a lock previously returned by Lock, so a
+	// job that runs longer than the backend's lease TTL doesn't lose its
+	// lock out from under it. It returns an error if id does not match
+	// the lock currently held for workspace (for example because the
+	// lease already expired and someone else acquired it).
+	Renew(workspace, id string) error
+}
+
+// NewStateBackend builds the StateBackend named by kind, configured from
+// config (the key/value pairs collected from repeated
+// -state-backend-config flags). kind is one of "local", "s3" or "gcs";
+// an empty kind defaults to "local".
+func NewStateBackend(kind string, config map[string]string) (StateBackend, error) {
+	switch kind {
+	case "", "local":
+		dir := config["dir"]
+		if dir == "" {
+			dir = "terraform-state"
+		}
+		return newLocalBackend(dir)
+	case "s3":
+		return newS3Backend(config)
+	case "gcs":
+		return newGCSBackend(config)
+	default:
+		return nil, fmt.Errorf("Unknown state backend: %q", kind)
+	}
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/hashicorp/go-uuid"
+	"google.golang.org/api/googleapi"
+)
+
+// gcsLeaseTTL bounds how long a gcsBackend lock object is honored; a lock
+// object older than this is treated as abandoned and may be replaced.
+const gcsLeaseTTL = 5 * time.Minute
+
+// gcsBackend stores state objects in a Google Cloud Storage bucket.
+// Locking has no native GCS primitive to lean on, so it is implemented
+// as a conditional ("create if absent") write of a lock object.
+type gcsBackend struct {
+	bucket    *storage.BucketHandle
+	keyPrefix string
+}
+
+func newGCSBackend(config map[string]string) (*gcsBackend, error) {
+	bucket := config["bucket"]
+	if bucket == "" {
+		return nil, fmt.Errorf(`gcs state backend requires a "bucket" config value`)
+	}
+
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create GCS client: %s", err)
+	}
+
+	return &gcsBackend{
+		bucket:    client.Bucket(bucket),
+		keyPrefix: config["key_prefix"],
+	}, nil
+}
+
+func (b *gcsBackend) key(workspace string) string {
+	return path.Join(b.keyPrefix, workspace+".tfstate")
+}
+
+func (b *gcsBackend) lockKey(workspace string) string {
+	return b.key(workspace) + ".lock"
+}
+
+func (b *gcsBackend) Load(workspace string) ([]byte, error) {
+	r, err := b.bucket.Object(b.key(workspace)).NewReader(context.Background())
+	if err == storage.ErrObjectNotExist {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *gcsBackend) Save(workspace string, state []byte) error {
+	ctx := context.Background()
+	w := b.bucket.Object(b.key(workspace)).NewWriter(ctx)
+	if _, err := w.Write(state); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (b *gcsBackend) Lock(workspace string) (string, error) {
+	ctx := context.Background()
+	obj := b.bucket.Object(b.lockKey(workspace))
+
+	cond := storage.Conditions{DoesNotExist: true}
+	if attrs, err := obj.Attrs(ctx); err == nil {
+		if time.Since(attrs.Updated) < gcsLeaseTTL {
+			return "", ErrLocked
+		}
+		// Replace the abandoned lock only if nobody else has already.
+		cond = storage.Conditions{GenerationMatch: attrs.Generation}
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+
+	w := obj.If(cond).NewWriter(ctx)
+	if _, err := w.Write([]byte(id)); err != nil {
+		w.Close()
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusPreconditionFailed {
+			return "", ErrLocked
+		}
+		return "", err
+	}
+	return id, nil
+}
+
+// Renew re-writes the lock object, which also refreshes its Updated
+// timestamp and so the lease window Lock checks, as long as it's still
+// held by id.
+func (b *gcsBackend) Renew(workspace, id string) error {
+	ctx := context.Background()
+	obj := b.bucket.Object(b.lockKey(workspace))
+
+	r, err := obj.NewReader(ctx)
+	if err != nil {
+		return fmt.Errorf("Lock %s not held for workspace %q", id, workspace)
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	if string(data) != id {
+		return fmt.Errorf("Lock %s not held for workspace %q", id, workspace)
+	}
+
+	w := obj.NewWriter(ctx)
+	if _, err := w.Write([]byte(id)); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (b *gcsBackend) Unlock(workspace, id string) error {
+	ctx := context.Background()
+	obj := b.bucket.Object(b.lockKey(workspace))
+
+	r, err := obj.NewReader(ctx)
+	if err != nil {
+		return fmt.Errorf("Lock %s not held for workspace %q", id, workspace)
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	if string(data) != id {
+		return fmt.Errorf("Lock %s not held for workspace %q", id, workspace)
+	}
+
+	return obj.Delete(ctx)
+}
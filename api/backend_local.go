@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+)
+
+// localLeaseTTL bounds how long a localBackend lock is honored without
+// being renewed, so a crashed caller can't wedge a workspace forever.
+const localLeaseTTL = 5 * time.Minute
+
+// localBackend stores each workspace's state as a file in a directory on
+// disk, with an in-memory leased lock per workspace.
+type localBackend struct {
+	dir string
+
+	mu     sync.Mutex
+	leases map[string]localLease
+}
+
+type localLease struct {
+	id      string
+	expires time.Time
+}
+
+func newLocalBackend(dir string) (*localBackend, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create state backend directory: %s", err)
+	}
+
+	return &localBackend{
+		dir:    dir,
+		leases: make(map[string]localLease),
+	}, nil
+}
+
+func (b *localBackend) path(workspace string) string {
+	return filepath.Join(b.dir, workspace+".tfstate")
+}
+
+func (b *localBackend) Load(workspace string) ([]byte, error) {
+	data, err := ioutil.ReadFile(b.path(workspace))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (b *localBackend) Save(workspace string, state []byte) error {
+	return ioutil.WriteFile(b.path(workspace), state, 0644)
+}
+
+func (b *localBackend) Lock(workspace string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if existing, ok := b.leases[workspace]; ok && time.Now().Before(existing.expires) {
+		return "", ErrLocked
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+
+	b.leases[workspace] = localLease{id: id, expires: time.Now().Add(localLeaseTTL)}
+	return id, nil
+}
+
+func (b *localBackend) Renew(workspace, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	existing, ok := b.leases[workspace]
+	if !ok || existing.id != id {
+		return fmt.Errorf("Lock %s not held for workspace %q", id, workspace)
+	}
+
+	b.leases[workspace] = localLease{id: id, expires: time.Now().Add(localLeaseTTL)}
+	return nil
+}
+
+func (b *localBackend) Unlock(workspace, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	existing, ok := b.leases[workspace]
+	if !ok || existing.id != id {
+		return fmt.Errorf("Lock %s not held for workspace %q", id, workspace)
+	}
+
+	delete(b.leases, workspace)
+	return nil
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func newTestLocalBackend(t *testing.T) *localBackend {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "backend-local-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	b, err := newLocalBackend(dir)
+	if err != nil {
+		t.Fatalf("newLocalBackend: %s", err)
+	}
+	return b
+}
+
+func TestLocalBackendLoadSave(t *testing.T) {
+	b := newTestLocalBackend(t)
+
+	if state, err := b.Load("default"); err != nil || state != nil {
+		t.Fatalf("Load of never-saved workspace = (%v, %v), want (nil, nil)", state, err)
+	}
+
+	if err := b.Save("default", []byte(`{"version": 4}`)); err != nil {
+		t.Fatalf("Save: %s", err)
+	}
+
+	state, err := b.Load("default")
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if string(state) != `{"version": 4}` {
+		t.Errorf("Load = %q, want %q", state, `{"version": 4}`)
+	}
+}
+
+func TestLocalBackendLockExclusion(t *testing.T) {
+	b := newTestLocalBackend(t)
+
+	id, err := b.Lock("default")
+	if err != nil {
+		t.Fatalf("Lock: %s", err)
+	}
+	if id == "" {
+		t.Fatal("Lock returned an empty id")
+	}
+
+	if _, err := b.Lock("default"); err != ErrLocked {
+		t.Fatalf("second Lock on held workspace = %v, want ErrLocked", err)
+	}
+
+	if _, err := b.Lock("other-workspace"); err != nil {
+		t.Fatalf("Lock on a different workspace should not be blocked: %s", err)
+	}
+
+	if err := b.Unlock("default", id); err != nil {
+		t.Fatalf("Unlock: %s", err)
+	}
+
+	if _, err := b.Lock("default"); err != nil {
+		t.Fatalf("Lock after Unlock: %s", err)
+	}
+}
+
+func TestLocalBackendUnlockWrongID(t *testing.T) {
+	b := newTestLocalBackend(t)
+
+	id, err := b.Lock("default")
+	if err != nil {
+		t.Fatalf("Lock: %s", err)
+	}
+
+	if err := b.Unlock("default", "not-the-real-id"); err == nil {
+		t.Fatal("Unlock with the wrong id: expected error, got nil")
+	}
+
+	if err := b.Unlock("default", id); err != nil {
+		t.Fatalf("Unlock with the correct id: %s", err)
+	}
+}
+
+func TestLocalBackendRenew(t *testing.T) {
+	b := newTestLocalBackend(t)
+
+	id, err := b.Lock("default")
+	if err != nil {
+		t.Fatalf("Lock: %s", err)
+	}
+
+	before := b.leases["default"].expires
+	if err := b.Renew("default", id); err != nil {
+		t.Fatalf("Renew: %s", err)
+	}
+	after := b.leases["default"].expires
+	if !after.After(before) {
+		t.Errorf("Renew did not extend the lease: before=%s after=%s", before, after)
+	}
+
+	if err := b.Renew("default", "not-the-real-id"); err == nil {
+		t.Fatal("Renew with the wrong id: expected error, got nil")
+	}
+
+	if err := b.Renew("never-locked-workspace", id); err == nil {
+		t.Fatal("Renew on a workspace with no lease: expected error, got nil")
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/go-uuid"
+)
+
+// s3LeaseTTL bounds how long an s3Backend DynamoDB lock is honored
+// without being renewed.
+const s3LeaseTTL = 5 * time.Minute
+
+// s3Backend stores state objects in an S3 bucket with server-side
+// encryption. When lockTable is configured it also uses a DynamoDB table
+// to provide workspace locking, the same pattern Terraform's own S3
+// remote state backend uses.
+type s3Backend struct {
+	bucket    string
+	keyPrefix string
+	s3        *s3.S3
+
+	lockTable string
+	dynamo    *dynamodb.DynamoDB
+}
+
+func newS3Backend(config map[string]string) (*s3Backend, error) {
+	bucket := config["bucket"]
+	if bucket == "" {
+		return nil, fmt.Errorf(`s3 state backend requires a "bucket" config value`)
+	}
+
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(config["region"])})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create AWS session: %s", err)
+	}
+
+	b := &s3Backend{
+		bucket:    bucket,
+		keyPrefix: config["key_prefix"],
+		s3:        s3.New(sess),
+		lockTable: config["lock_table"],
+	}
+	if b.lockTable != "" {
+		b.dynamo = dynamodb.New(sess)
+	}
+	return b, nil
+}
+
+func (b *s3Backend) key(workspace string) string {
+	return path.Join(b.keyPrefix, workspace+".tfstate")
+}
+
+func (b *s3Backend) Load(workspace string) ([]byte, error) {
+	out, err := b.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(workspace)),
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	return ioutil.ReadAll(out.Body)
+}
+
+func (b *s3Backend) Save(workspace string, state []byte) error {
+	_, err := b.s3.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(b.bucket),
+		Key:                  aws.String(b.key(workspace)),
+		Body:                 bytes.NewReader(state),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAes256),
+	})
+	return err
+}
+
+func (b *s3Backend) Lock(workspace string) (string, error) {
+	if b.dynamo == nil {
+		return "", nil
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = b.dynamo.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(b.lockTable),
+		Item: map[string]*dynamodb.AttributeValue{
+			"LockID":  {S: aws.String(b.key(workspace))},
+			"Info":    {S: aws.String(id)},
+			"Expires": {N: aws.String(fmt.Sprintf("%d", now.Add(s3LeaseTTL).Unix()))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(LockID) OR Expires < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(fmt.Sprintf("%d", now.Unix()))},
+		},
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return "", ErrLocked
+		}
+		return "", err
+	}
+	return id, nil
+}
+
+// Renew re-writes the DynamoDB lock item with a fresh expiry, as long as
+// it's still held by id, extending the lease for a job still in flight.
+func (b *s3Backend) Renew(workspace, id string) error {
+	if b.dynamo == nil {
+		return nil
+	}
+
+	now := time.Now()
+	_, err := b.dynamo.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(b.lockTable),
+		Item: map[string]*dynamodb.AttributeValue{
+			"LockID":  {S: aws.String(b.key(workspace))},
+			"Info":    {S: aws.String(id)},
+			"Expires": {N: aws.String(fmt.Sprintf("%d", now.Add(s3LeaseTTL).Unix()))},
+		},
+		ConditionExpression: aws.String("Info = :id"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id": {S: aws.String(id)},
+		},
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return fmt.Errorf("Lock %s not held for workspace %q", id, workspace)
+	}
+	return err
+}
+
+func (b *s3Backend) Unlock(workspace, id string) error {
+	if b.dynamo == nil {
+		return nil
+	}
+
+	_, err := b.dynamo.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(b.lockTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"LockID": {S: aws.String(b.key(workspace))},
+		},
+		ConditionExpression: aws.String("Info = :id"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id": {S: aws.String(id)},
+		},
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return fmt.Errorf("Lock %s not held for workspace %q", id, workspace)
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type bundleEntry struct {
+	name string
+	body string
+}
+
+// buildBundle tars and gzips entries into a bundle suitable for
+// extractBundle, in order.
+func buildBundle(t *testing.T, entries ...bundleEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name: e.name,
+			Mode: 0644,
+			Size: int64(len(e.body)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("WriteHeader(%s): %s", e.name, err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatalf("Write(%s): %s", e.name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar Close: %s", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip Close: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractBundle(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []bundleEntry
+		wantErr bool
+	}{
+		{
+			name: "normal bundle extracts under dest",
+			entries: []bundleEntry{
+				{"main.tf", "resource \"null_resource\" \"x\" {}"},
+				{"modules/child/main.tf", "# child module"},
+			},
+		},
+		{
+			name: "parent traversal is rejected",
+			entries: []bundleEntry{
+				{"../escape.tf", "evil"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "nested parent traversal is rejected",
+			entries: []bundleEntry{
+				{"modules/../../escape.tf", "evil"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "absolute path is rejected",
+			entries: []bundleEntry{
+				{"/etc/passwd", "evil"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, err := ioutil.TempDir("", "bundle-test")
+			if err != nil {
+				t.Fatalf("TempDir: %s", err)
+			}
+			defer os.RemoveAll(dest)
+
+			data := buildBundle(t, tt.entries...)
+
+			err = extractBundle(dest, data, 0)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("extractBundle(%v): expected error, got nil", tt.entries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractBundle(%v): unexpected error: %s", tt.entries, err)
+			}
+			if _, err := os.Stat(filepath.Join(dest, "main.tf")); err != nil {
+				t.Fatalf("expected main.tf to be extracted: %s", err)
+			}
+		})
+	}
+}
+
+func TestExtractBundleMaxBytes(t *testing.T) {
+	dest, err := ioutil.TempDir("", "bundle-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dest)
+
+	data := buildBundle(t, bundleEntry{"main.tf", "0123456789"})
+
+	if err := extractBundle(dest, data, 5); err == nil {
+		t.Fatal("extractBundle: expected error when bundle exceeds maxBundleBytes, got nil")
+	}
+}
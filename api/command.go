@@ -2,7 +2,9 @@ package api
 
 import (
 	"flag"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform/command"
 )
@@ -13,6 +15,62 @@ type ApiCommand struct {
 	command.Meta
 	ShutdownCommandCh chan struct{}
 	ShutdownServerCh  <-chan struct{}
+
+	// TLSCert, TLSKey and TLSClientCA configure the server's listener.
+	// TLSClientCA additionally switches on mutual TLS, requiring and
+	// verifying a client certificate signed by that CA.
+	TLSCert     string
+	TLSKey      string
+	TLSClientCA string
+
+	// AuthTokenFile, when set, restricts the API to callers that present
+	// one of the bearer tokens it contains.
+	AuthTokenFile string
+
+	// JobStoreDir, when set, persists job metadata to disk so the server
+	// can report on jobs that were in flight across a restart.
+	JobStoreDir string
+
+	// StateBackendKind and StateBackendConfig select and configure the
+	// StateBackend used to load/save state per workspace, instead of
+	// requiring every request to carry the full state blob.
+	StateBackendKind   string
+	StateBackendConfig map[string]string
+
+	// LogFormat, when set to "json", makes the API emit one structured
+	// JSON log line per request via Logger instead of staying silent.
+	LogFormat string
+	Logger    RequestLogger
+
+	// MaxBundleBytes caps the total decompressed size of a Bundle module
+	// archive. 0 means unlimited.
+	MaxBundleBytes int64
+
+	// ShutdownTimeout bounds how long a shutdown waits for outstanding
+	// apply/plan/refresh requests to drain before proceeding anyway.
+	ShutdownTimeout string
+
+	authStore       *AuthStore
+	jobs            *JobStore
+	stateBackend    StateBackend
+	shutdown        *shutdownCoordinator
+	shutdownTimeout time.Duration
+}
+
+// backendConfigFlag collects repeated -state-backend-config=key=value
+// flags into a map, the same way -backend-config works for `terraform
+// init`.
+type backendConfigFlag map[string]string
+
+func (f backendConfigFlag) String() string { return "" }
+
+func (f backendConfigFlag) Set(raw string) error {
+	parts := strings.SplitN(raw, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("-state-backend-config must be key=value, got %q", raw)
+	}
+	f[parts[0]] = parts[1]
+	return nil
 }
 
 func (c *ApiCommand) Run(args []string) int {
@@ -24,11 +82,66 @@ func (c *ApiCommand) Run(args []string) int {
 	cmdFlags := flag.NewFlagSet("api", flag.ContinueOnError)
 	cmdFlags.StringVar(&ip, "ip", "127.0.0.1", "127.0.0.1")
 	cmdFlags.IntVar(&port, "port", 8080, "8080")
+	cmdFlags.StringVar(&c.TLSCert, "tls-cert", "", "")
+	cmdFlags.StringVar(&c.TLSKey, "tls-key", "", "")
+	cmdFlags.StringVar(&c.TLSClientCA, "tls-client-ca", "", "")
+	cmdFlags.StringVar(&c.AuthTokenFile, "auth-token-file", "", "")
+	cmdFlags.StringVar(&c.JobStoreDir, "job-store-dir", "", "")
+	cmdFlags.StringVar(&c.StateBackendKind, "state-backend", "", "")
+	c.StateBackendConfig = make(map[string]string)
+	cmdFlags.Var(backendConfigFlag(c.StateBackendConfig), "state-backend-config", "")
+	cmdFlags.StringVar(&c.LogFormat, "log-format", "", "")
+	cmdFlags.Int64Var(&c.MaxBundleBytes, "max-bundle-bytes", 0, "")
+	cmdFlags.StringVar(&c.ShutdownTimeout, "shutdown-timeout", "5m", "")
 	cmdFlags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
+	shutdownTimeout, err := time.ParseDuration(c.ShutdownTimeout)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Invalid -shutdown-timeout: %s", err))
+		return 1
+	}
+	c.shutdownTimeout = shutdownTimeout
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		c.Ui.Error("-tls-cert and -tls-key must be set together")
+		return 1
+	}
+
+	if c.TLSClientCA != "" && c.TLSCert == "" {
+		c.Ui.Error("-tls-client-ca requires -tls-cert and -tls-key to also be set")
+		return 1
+	}
+
+	if c.AuthTokenFile != "" {
+		store, err := NewAuthStore(c.AuthTokenFile)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.authStore = store
+	}
+
+	if c.StateBackendKind != "" {
+		backend, err := NewStateBackend(c.StateBackendKind, c.StateBackendConfig)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.stateBackend = backend
+	}
+
+	switch c.LogFormat {
+	case "":
+	case "json":
+		c.Logger = newJSONRequestLogger()
+	default:
+		c.Ui.Error(fmt.Sprintf("Unknown -log-format: %s", c.LogFormat))
+		return 1
+	}
+
 	c.startApi(ip, port)
 
 	return 0
@@ -38,7 +151,9 @@ func (c *ApiCommand) Help() string {
 	helpText := `
 Usage: terraform api [options]
 
-  Run Terraform as a service providing a RESTful API endpoint.
+  Run Terraform as a service providing a RESTful API endpoint. Prometheus
+  metrics are always available at GET /metrics, and liveness/readiness
+  checks at GET /healthz and GET /readyz.
 
 Options:
 
@@ -47,6 +162,58 @@ Options:
 
   -port=8080              The port the service will bind to. Defaults to 8080.
 
+  -tls-cert=path          Path to a PEM-encoded certificate to serve TLS
+                          with. Must be set together with -tls-key.
+
+  -tls-key=path           Path to the PEM-encoded private key for -tls-cert.
+
+  -tls-client-ca=path     Path to a PEM bundle of CA certificates used to
+                          verify client certificates. Setting this enables
+                          mutual TLS: requests without a valid client
+                          certificate are rejected.
+
+  -auth-token-file=path   Path to a file of bearer tokens allowed to call
+                          the API. Each line is "token" or
+                          "token:scope,scope", where scope is one of
+                          plan, apply, destroy, refresh or read (read
+                          authorizes GET /jobs and GET /jobs/{id}/logs).
+                          A token with no scopes is granted all of them.
+                          When this flag is unset the API is
+                          unauthenticated.
+
+  -job-store-dir=path     Directory to persist job metadata to, so that
+                          GET /jobs/{id} survives an API server restart.
+                          Defaults to keeping jobs in memory only.
+
+  -state-backend=kind     State backend to load/save workspace state
+                          through, instead of requiring the full state
+                          blob in every request: "local", "s3" or "gcs".
+                          Unset by default, meaning no backend is used and
+                          state comes only from each request.
+
+  -state-backend-config=key=value
+                          A key/value pair of backend-specific
+                          configuration. May be repeated. "local" accepts
+                          "dir"; "s3" accepts "bucket", "region",
+                          "key_prefix" and "lock_table" (enabling
+                          DynamoDB locking); "gcs" accepts "bucket" and
+                          "key_prefix".
+
+  -log-format=json        Emit one structured JSON log line per request
+                          (method, path, remote address, status, duration,
+                          job id and Terraform exit code). Unset by
+                          default, meaning no per-request logging.
+
+  -max-bundle-bytes=n     Maximum total decompressed size, in bytes, of a
+                          tar.gz module Bundle submitted in a request.
+                          Defaults to 0, meaning unlimited.
+
+  -shutdown-timeout=5m    How long to wait for outstanding apply/plan/refresh
+                          requests to finish once shutdown begins, before
+                          proceeding anyway. GET /readyz starts returning 503
+                          as soon as shutdown begins, so load balancers can
+                          stop sending new requests during the wait.
+
 `
 	return strings.TrimSpace(helpText)
 }
@@ -0,0 +1,298 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+)
+
+// JobStatus is the lifecycle state of a Job.
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+// Job tracks a single plan/apply/refresh run submitted to a JobStore. It
+// is what GET /jobs/{id} serializes back to the caller.
+type Job struct {
+	ID        string    `json:"id"`
+	Operation string    `json:"operation"`
+	Status    JobStatus `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Response  *Response `json:"response,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Scope is the scope a bearer token needed in order to submit this
+	// job. It is recorded at submission time rather than re-derived from
+	// Operation, since "apply" is submitted under either ScopeApply or
+	// ScopeDestroy depending on whether the request was a destroy.
+	Scope Scope `json:"scope"`
+
+	ui     *StreamingUi
+	cancel context.CancelFunc
+}
+
+// JobStore runs and tracks asynchronous plan/apply/refresh operations.
+// Jobs are optionally persisted to disk so a restarted API server can
+// report on work that was in flight when it stopped.
+type JobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+	wg   sync.WaitGroup
+
+	dir     string
+	rootCtx context.Context
+}
+
+// NewJobStore creates a JobStore that persists job metadata under dir, or
+// keeps it in memory only when dir is empty. shutdown, when it fires,
+// cancels every job still running so they can exit cooperatively instead
+// of being abandoned mid-write.
+func NewJobStore(dir string, shutdown <-chan struct{}) (*JobStore, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("Failed to create job store directory: %s", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &JobStore{
+		jobs:    make(map[string]*Job),
+		dir:     dir,
+		rootCtx: ctx,
+	}
+
+	if err := s.restore(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-shutdown
+		cancel()
+	}()
+
+	return s, nil
+}
+
+// restore loads job metadata left behind by a previous run of the server.
+// Any job that was still pending or running when the server stopped
+// could not have finished, so it is surfaced as failed rather than left
+// stuck forever.
+func (s *JobStore) restore() error {
+	if s.dir == "" {
+		return nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("Failed to list job store directory: %s", err)
+	}
+
+	for _, m := range matches {
+		data, err := ioutil.ReadFile(m)
+		if err != nil {
+			continue
+		}
+
+		var j Job
+		if err := json.Unmarshal(data, &j); err != nil {
+			continue
+		}
+
+		if j.Status == JobPending || j.Status == JobRunning {
+			j.Status = JobFailed
+			j.Error = "API server restarted while job was in progress"
+			j.UpdatedAt = time.Now()
+		}
+
+		// A restored job has no live StreamingUi to stream from, but it
+		// needs a non-nil, already-closed one so GET /jobs/{id}/logs gets
+		// an empty stream instead of panicking on a nil logBroadcaster.
+		j.ui = NewStreamingUi()
+		j.ui.logs.close()
+
+		s.jobs[j.ID] = &j
+	}
+
+	return nil
+}
+
+func (s *JobStore) persist(j *Job) {
+	if s.dir == "" {
+		return
+	}
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		return
+	}
+	ioutil.WriteFile(filepath.Join(s.dir, j.ID+".json"), data, 0644)
+}
+
+// Submit starts run in a new goroutine and returns immediately with a Job
+// in the "pending" state. scope is the Scope a caller needed in order to
+// reach this point, recorded on the Job so a later DELETE /jobs/{id} can
+// be authorized against it. run is handed a context that is canceled
+// when the job is canceled or the server shuts down, and a StreamingUi
+// to pass to the underlying Terraform command. cleanup runs
+// unconditionally once the goroutine starts, whether or not run itself
+// ever gets called, so a caller can use it to release resources (a
+// workspace lock, a temp directory) that were acquired before Submit
+// regardless of a cancel-before-start race.
+func (s *JobStore) Submit(operation string, scope Scope, cleanup func(), run func(ctx context.Context, ui *StreamingUi) *Response) *Job {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		id = fmt.Sprintf("job-%d", time.Now().UnixNano())
+	}
+
+	ctx, cancel := context.WithCancel(s.rootCtx)
+	now := time.Now()
+	job := &Job{
+		ID:        id,
+		Operation: operation,
+		Status:    JobPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Scope:     scope,
+		ui:        NewStreamingUi(),
+		cancel:    cancel,
+	}
+
+	s.mu.Lock()
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+	s.persist(job)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cleanup()
+
+		if ctx.Err() != nil {
+			s.update(job, func() {
+				job.Status = JobCanceled
+				job.Error = "Canceled before it started running"
+			})
+			job.ui.logs.close()
+			return
+		}
+
+		s.update(job, func() {
+			job.Status = JobRunning
+		})
+		activeJobs.Inc()
+
+		runStart := time.Now()
+		resp := run(ctx, job.ui)
+		operationDuration.WithLabelValues(operation).Observe(time.Since(runStart).Seconds())
+		activeJobs.Dec()
+
+		// ctx may have been canceled while run was executing (job
+		// cancellation is a no-op once running, and shutdown now waits
+		// for run to return instead of canceling it), but run already
+		// ran to completion by the time we get here, so the outcome is
+		// whatever it actually produced, not "canceled".
+		s.update(job, func() {
+			job.Response = resp
+			switch {
+			case resp != nil && resp.ExitCode != 0:
+				job.Status = JobFailed
+				job.Error = resp.Error
+			default:
+				job.Status = JobSucceeded
+			}
+		})
+		job.ui.logs.close()
+	}()
+
+	return job
+}
+
+// Wait blocks until every job currently running has finished, or timeout
+// elapses, whichever comes first. startApi's shutdown goroutine calls
+// this so the process doesn't exit out from under an in-flight apply.
+func (s *JobStore) Wait(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+func (s *JobStore) update(job *Job, mutate func()) {
+	s.mu.Lock()
+	mutate()
+	job.UpdatedAt = time.Now()
+	s.mu.Unlock()
+	s.persist(job)
+}
+
+// Get returns a point-in-time copy of the job with the given id, if any.
+// It copies the Job under the store's lock so callers never observe a
+// torn write from a job goroutine's concurrent call to update.
+func (s *JobStore) Get(id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	snapshot := *j
+	return &snapshot, true
+}
+
+// List returns a point-in-time copy of every known job, in no particular
+// order.
+func (s *JobStore) List() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		snapshot := *j
+		jobs = append(jobs, &snapshot)
+	}
+	return jobs
+}
+
+// Cancel requests that the job with the given id stop. Since the
+// underlying Terraform command has no way to be interrupted once it has
+// started running, this only has an effect on a job that hasn't started
+// yet: it prevents that job from ever entering the "running" state.
+// Cancel on a job that is already running or has finished returns an
+// error instead of pretending to stop it.
+func (s *JobStore) Cancel(id string) error {
+	s.mu.Lock()
+	j, ok := s.jobs[id]
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("Unknown job: %s", id)
+	}
+
+	if j.Status != JobPending {
+		return fmt.Errorf("Job %s is %s and can no longer be canceled: a running Terraform command cannot be interrupted", id, j.Status)
+	}
+
+	j.cancel()
+	return nil
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// RequestLogEntry is one structured log line emitted per API request
+// when -log-format=json is set.
+type RequestLogEntry struct {
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	RemoteAddr string  `json:"remote_addr"`
+	Status     int     `json:"status"`
+	Duration   float64 `json:"duration_seconds"`
+	JobID      string  `json:"job_id,omitempty"`
+	ExitCode   int     `json:"exit_code,omitempty"`
+}
+
+// RequestLogger receives one entry per completed API request. It's a
+// small interface, rather than a hardcoded writer, so tests can capture
+// entries directly instead of parsing stdout.
+type RequestLogger interface {
+	LogRequest(entry RequestLogEntry)
+}
+
+// jsonRequestLogger writes each RequestLogEntry to w as a single line of
+// JSON, the format -log-format=json asks for.
+type jsonRequestLogger struct {
+	w io.Writer
+}
+
+func newJSONRequestLogger() *jsonRequestLogger {
+	return &jsonRequestLogger{w: os.Stdout}
+}
+
+func (l *jsonRequestLogger) LogRequest(entry RequestLogEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(l.w, string(data))
+}
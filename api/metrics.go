@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "terraform_api",
+		Name:      "requests_total",
+		Help:      "Total API requests, by method, route and response status.",
+	}, []string{"method", "route", "status"})
+
+	// operationDuration is observed by JobStore.Submit once a job's run
+	// function returns, not by instrumentationFilter: apply/plan/refresh
+	// requests return as soon as the job is submitted, so timing the HTTP
+	// handler would only ever measure job submission, not the Terraform
+	// operation itself.
+	operationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "terraform_api",
+		Name:      "operation_duration_seconds",
+		Help:      "Time for a plan/apply/refresh job to run to completion.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	activeJobs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "terraform_api",
+		Name:      "active_jobs",
+		Help:      "Number of plan/apply/refresh jobs currently running.",
+	})
+
+	payloadBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "terraform_api",
+		Name:      "payload_bytes_total",
+		Help:      "Bytes of state/plan payload read from or written to requests and responses.",
+	}, []string{"kind", "direction"})
+)
+
+func init() {
+	// The Go runtime and process collectors round out /metrics the same
+	// way they do for every other Prometheus-instrumented Go service.
+	prometheus.MustRegister(requestsTotal, operationDuration, activeJobs, payloadBytes)
+}
+
+// registerMetricsEndpoint exposes /metrics in Prometheus text format on
+// the default ServeMux, alongside the go-restful routes registered in
+// registerEndpoints.
+func (c *ApiCommand) registerMetricsEndpoint() {
+	http.Handle("/metrics", promhttp.Handler())
+}
+
+// instrumentationFilter is a go-restful filter wrapping every route. It
+// records Prometheus metrics for the request and, when -log-format=json
+// is set, emits a RequestLogEntry for it.
+func (c *ApiCommand) instrumentationFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	start := time.Now()
+
+	chain.ProcessFilter(req, resp)
+
+	duration := time.Since(start)
+	status := resp.StatusCode()
+	route := req.SelectedRoutePath()
+
+	requestsTotal.WithLabelValues(req.Request.Method, route, strconv.Itoa(status)).Inc()
+
+	if c.Logger == nil {
+		return
+	}
+
+	entry := RequestLogEntry{
+		Method:     req.Request.Method,
+		Path:       req.Request.URL.Path,
+		RemoteAddr: req.Request.RemoteAddr,
+		Status:     status,
+		Duration:   duration.Seconds(),
+	}
+	if jobID, ok := req.Attribute("job_id").(string); ok {
+		entry.JobID = jobID
+	}
+	if exitCode, ok := req.Attribute("exit_code").(int); ok {
+		entry.ExitCode = exitCode
+	}
+	c.Logger.LogRequest(entry)
+}
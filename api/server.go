@@ -2,6 +2,9 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -9,8 +12,13 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/emicklei/go-restful"
 	"github.com/hashicorp/terraform/command"
@@ -21,19 +29,47 @@ const (
 	CONFIGFILE = "terraform.tf"
 	PLANFILE   = "terraform.tfplan"
 	STATEFILE  = "terraform.tfstate"
+
+	// lockRenewInterval is how often an in-flight job renews its
+	// workspace lock. It needs to be comfortably shorter than every
+	// backend's lease TTL (5 minutes as of this writing) so a slow
+	// renewal or a missed tick doesn't let the lease lapse.
+	lockRenewInterval = time.Minute
 )
 
+// validWorkspace matches the {workspace} path parameter before it is ever
+// used to build a state file path, a lock table key, or an object name.
+// Every StateBackend concatenates workspace directly into a path or key,
+// so without this check a workspace of ".." or "../../etc" would reach
+// disk or a remote backend as untrusted input.
+var validWorkspace = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+
 type files struct {
 	tempDir    string
 	configFile string
 	planFile   string
 	stateFile  string
+
+	// varArgs holds the -var= and -var-file= arguments derived from the
+	// request's Vars and VarFiles, ready to append to the command line.
+	varArgs []string
 }
 
 type Request struct {
 	Config json.RawMessage
 	Plan   []byte
 	State  json.RawMessage
+
+	// Bundle is a tar.gz module bundle, used instead of Config when a
+	// module needs more than a single terraform.tf: multiple .tf files,
+	// a provider lock file, nested modules, and so on. Config keeps
+	// working unchanged when Bundle is omitted.
+	Bundle []byte
+
+	// Vars and VarFiles are passed to the underlying command as
+	// -var=key=value and -var-file= arguments respectively.
+	Vars     map[string]string
+	VarFiles map[string][]byte
 }
 
 type Response struct {
@@ -46,17 +82,98 @@ type Response struct {
 	ExitCode int
 }
 
+// JobRef is returned from POST /plan, PUT /apply and PUT /refresh so a
+// caller can follow up with GET /jobs/{id} or stream GET /jobs/{id}/logs.
+type JobRef struct {
+	JobID string `json:"job_id"`
+}
+
 func (c *ApiCommand) startApi(ip string, port int) {
 	c.ShutdownCommandCh = make(chan struct{}, 1)
+
+	jobs, err := NewJobStore(c.JobStoreDir, c.ShutdownCommandCh)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return
+	}
+	c.jobs = jobs
+	c.shutdown = newShutdownCoordinator()
+
 	c.registerEndpoints()
+	c.registerMetricsEndpoint()
 
 	go func() {
 		<-c.ShutdownServerCh
+		// Stop accepting new work, then give jobs already running a
+		// chance to finish writing state before the command channel and
+		// listener go away out from under them.
+		c.shutdown.beginDraining()
+		c.jobs.Wait(c.shutdownTimeout)
 		c.ShutdownCommandCh <- struct{}{}
 		graceful.Close()
 	}()
 
-	graceful.ListenAndServe(fmt.Sprintf("%s:%d", ip, port), nil)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if c.authStore != nil {
+				if err := c.authStore.Reload(c.AuthTokenFile); err != nil {
+					c.Ui.Error(fmt.Sprintf("Failed to reload -auth-token-file: %s", err))
+				}
+			}
+		}
+	}()
+
+	addr := fmt.Sprintf("%s:%d", ip, port)
+
+	if c.TLSCert == "" {
+		graceful.ListenAndServe(addr, nil)
+		return
+	}
+
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to configure TLS: %s", err))
+		return
+	}
+
+	listener, err := tls.Listen("tcp", addr, tlsConfig)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to listen on %s: %s", addr, err))
+		return
+	}
+
+	graceful.Serve(listener)
+}
+
+// tlsConfig builds the server's TLS configuration from the -tls-cert,
+// -tls-key and -tls-client-ca flags, switching on mutual TLS whenever a
+// client CA bundle is supplied.
+func (c *ApiCommand) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load TLS certificate: %s", err)
+	}
+
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if c.TLSClientCA != "" {
+		pem, err := ioutil.ReadFile(c.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read client CA bundle: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %s", c.TLSClientCA)
+		}
+
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
 }
 
 func (c *ApiCommand) registerEndpoints() {
@@ -65,24 +182,113 @@ func (c *ApiCommand) registerEndpoints() {
 		Path("/").
 		Consumes(restful.MIME_JSON).
 		Produces(restful.MIME_JSON)
-
-	ws.Route(ws.PUT("/apply").To(c.apply))
-	ws.Route(ws.DELETE("/apply").To(c.apply))
-	ws.Route(ws.POST("/plan").To(c.plan))
-	ws.Route(ws.DELETE("/plan").To(c.plan))
-	ws.Route(ws.PUT("/refresh").To(c.refresh))
+	ws.Filter(c.instrumentationFilter)
+
+	ws.Route(ws.PUT("/apply").Filter(c.scopeFilter(ScopeApply)).To(c.apply))
+	ws.Route(ws.PUT("/apply/{workspace}").Filter(c.scopeFilter(ScopeApply)).To(c.apply))
+	ws.Route(ws.DELETE("/apply").Filter(c.scopeFilter(ScopeDestroy)).To(c.apply))
+	ws.Route(ws.DELETE("/apply/{workspace}").Filter(c.scopeFilter(ScopeDestroy)).To(c.apply))
+	ws.Route(ws.POST("/plan").Filter(c.scopeFilter(ScopePlan)).To(c.plan))
+	ws.Route(ws.POST("/plan/{workspace}").Filter(c.scopeFilter(ScopePlan)).To(c.plan))
+	ws.Route(ws.DELETE("/plan").Filter(c.scopeFilter(ScopePlan)).To(c.plan))
+	ws.Route(ws.DELETE("/plan/{workspace}").Filter(c.scopeFilter(ScopePlan)).To(c.plan))
+	ws.Route(ws.PUT("/refresh").Filter(c.scopeFilter(ScopeRefresh)).To(c.refresh))
+	ws.Route(ws.PUT("/refresh/{workspace}").Filter(c.scopeFilter(ScopeRefresh)).To(c.refresh))
+
+	ws.Route(ws.GET("/jobs").Filter(c.scopeFilter(ScopeRead)).To(c.jobList))
+	ws.Route(ws.GET("/jobs/{id}").Filter(c.scopeFilter(ScopeRead)).To(c.jobGet))
+	ws.Route(ws.GET("/jobs/{id}/logs").Filter(c.scopeFilter(ScopeRead)).To(c.jobLogs))
+	ws.Route(ws.DELETE("/jobs/{id}").Filter(c.jobOperationScopeFilter).To(c.jobCancel))
+
+	ws.Route(ws.GET("/healthz").To(c.healthz))
+	ws.Route(ws.GET("/readyz").To(c.readyz))
 
 	restful.Add(ws)
 }
 
+// workspace returns the {workspace} path parameter, defaulting to
+// "default" when the caller used one of the workspace-less routes, and
+// rejects anything that isn't a safe path/key component: every
+// StateBackend concatenates it straight into a file path, lock table
+// key, or object name.
+func (c *ApiCommand) workspace(req *restful.Request) (string, error) {
+	ws := req.PathParameter("workspace")
+	if ws == "" {
+		return "default", nil
+	}
+	if !validWorkspace.MatchString(ws) || strings.Contains(ws, "..") {
+		return "", fmt.Errorf("Invalid workspace %q", ws)
+	}
+	return ws, nil
+}
+
+// lockWorkspace acquires a lease on workspace through the configured
+// StateBackend, if any, returning the lock id to pass to Unlock. When no
+// backend is configured it returns an empty lock id and a nil error,
+// since locking only makes sense once state lives behind a shared
+// backend.
+func (c *ApiCommand) lockWorkspace(workspace string) (lockID string, code int, err error) {
+	if c.stateBackend == nil {
+		return "", http.StatusOK, nil
+	}
+
+	lockID, err = c.stateBackend.Lock(workspace)
+	if err == ErrLocked {
+		return "", http.StatusConflict, fmt.Errorf("Workspace %q is locked by another operation", workspace)
+	}
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	return lockID, http.StatusOK, nil
+}
+
+func (c *ApiCommand) unlockWorkspace(workspace, lockID string) {
+	if c.stateBackend == nil {
+		return
+	}
+	c.stateBackend.Unlock(workspace, lockID)
+}
+
+// renewLock periodically renews workspace's lock for as long as a job
+// holds it, since a single apply/plan/refresh can easily run longer than
+// a backend's lease TTL. It returns once done is closed.
+func (c *ApiCommand) renewLock(workspace, lockID string, done <-chan struct{}) {
+	if c.stateBackend == nil || lockID == "" {
+		return
+	}
+
+	ticker := time.NewTicker(lockRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.stateBackend.Renew(workspace, lockID)
+		case <-done:
+			return
+		}
+	}
+}
+
 func (c *ApiCommand) apply(req *restful.Request, resp *restful.Response) {
-	f, code, err := c.createFiles(req)
+	workspace, err := c.workspace(req)
+	if err != nil {
+		resp.WriteError(http.StatusBadRequest, err)
+		return
+	}
+
+	lockID, code, err := c.lockWorkspace(workspace)
 	if err != nil {
 		resp.WriteError(code, err)
 		return
 	}
 
-	defer os.RemoveAll(f.tempDir)
+	f, code, err := c.createFiles(req, workspace)
+	if err != nil {
+		c.unlockWorkspace(workspace, lockID)
+		resp.WriteError(code, err)
+		return
+	}
 
 	// Set the arguments to be passed to the command
 	args := []string{
@@ -95,38 +301,58 @@ func (c *ApiCommand) apply(req *restful.Request, resp *restful.Response) {
 	if f.planFile != "" {
 		args = append(args, f.planFile)
 	} else {
+		args = append(args, f.varArgs...)
 		args = append(args, f.tempDir)
 	}
 
-	outputs := NewApiUi()
-	cmd := &command.ApplyCommand{
-		Meta: c.apiMeta(c.Meta, outputs),
+	destroy := req.Request.Method == "DELETE"
+	scope := ScopeApply
+	if destroy {
+		scope = ScopeDestroy
 	}
 
-	if req.Request.Method == "DELETE" {
-		cmd.Destroy = true
+	cleanup := func() {
+		os.RemoveAll(f.tempDir)
+		c.unlockWorkspace(workspace, lockID)
 	}
 
-	r := c.processResults(cmd.Run(args), outputs)
+	job := c.jobs.Submit("apply", scope, cleanup, func(ctx context.Context, ui *StreamingUi) *Response {
+		renewDone := make(chan struct{})
+		defer close(renewDone)
+		go c.renewLock(workspace, lockID, renewDone)
 
-	r.State, err = ioutil.ReadFile(f.stateFile)
-	if err != nil {
-		resp.WriteError(http.StatusInternalServerError,
-			fmt.Errorf("Failed to read state from disk: %s", err))
-		return
-	}
+		cmd := &command.ApplyCommand{
+			Meta:    c.apiMeta(c.Meta, ui),
+			Destroy: destroy,
+		}
+
+		r := c.processResults(cmd.Run(args), ui)
+		c.saveState(r, workspace, f.stateFile)
+		return r
+	})
 
-	resp.WriteAsJson(r)
+	c.writeJobRef(req, resp, job)
 }
 
 func (c *ApiCommand) plan(req *restful.Request, resp *restful.Response) {
-	f, code, err := c.createFiles(req)
+	workspace, err := c.workspace(req)
+	if err != nil {
+		resp.WriteError(http.StatusBadRequest, err)
+		return
+	}
+
+	lockID, code, err := c.lockWorkspace(workspace)
 	if err != nil {
 		resp.WriteError(code, err)
 		return
 	}
 
-	defer os.RemoveAll(f.tempDir)
+	f, code, err := c.createFiles(req, workspace)
+	if err != nil {
+		c.unlockWorkspace(workspace, lockID)
+		resp.WriteError(code, err)
+		return
+	}
 
 	// As we are creating a new plan, make sure we have a plan filename
 	f.planFile = filepath.Join(f.tempDir, PLANFILE)
@@ -138,74 +364,194 @@ func (c *ApiCommand) plan(req *restful.Request, resp *restful.Response) {
 		"-no-color",
 		"-state=" + f.stateFile,
 		"-out=" + f.planFile,
-		f.tempDir,
 	}
+	args = append(args, f.varArgs...)
+	args = append(args, f.tempDir)
 
 	if req.Request.Method == "DELETE" {
 		args = append(args, "-destroy")
 	}
 
-	outputs := NewApiUi()
-	cmd := &command.PlanCommand{
-		Meta: c.apiMeta(c.Meta, outputs),
+	cleanup := func() {
+		os.RemoveAll(f.tempDir)
+		c.unlockWorkspace(workspace, lockID)
 	}
 
-	r := c.processResults(cmd.Run(args), outputs)
+	job := c.jobs.Submit("plan", ScopePlan, cleanup, func(ctx context.Context, ui *StreamingUi) *Response {
+		renewDone := make(chan struct{})
+		defer close(renewDone)
+		go c.renewLock(workspace, lockID, renewDone)
+
+		cmd := &command.PlanCommand{
+			Meta: c.apiMeta(c.Meta, ui),
+		}
+
+		r := c.processResults(cmd.Run(args), ui)
+
+		if plan, err := ioutil.ReadFile(f.planFile); err == nil {
+			r.Plan = base64.StdEncoding.EncodeToString(plan)
+			payloadBytes.WithLabelValues("plan", "write").Add(float64(len(plan)))
+		} else {
+			failResult(r, "Failed to read plan from disk: %s", err)
+		}
+
+		c.saveState(r, workspace, f.stateFile)
+		return r
+	})
+
+	c.writeJobRef(req, resp, job)
+}
 
-	plan, err := ioutil.ReadFile(f.planFile)
+func (c *ApiCommand) refresh(req *restful.Request, resp *restful.Response) {
+	workspace, err := c.workspace(req)
 	if err != nil {
-		resp.WriteError(http.StatusInternalServerError,
-			fmt.Errorf("Failed to read plan from disk: %s", err))
+		resp.WriteError(http.StatusBadRequest, err)
 		return
 	}
-	r.Plan = base64.StdEncoding.EncodeToString(plan)
 
-	r.State, err = ioutil.ReadFile(f.stateFile)
+	lockID, code, err := c.lockWorkspace(workspace)
 	if err != nil {
-		resp.WriteError(http.StatusInternalServerError,
-			fmt.Errorf("Failed to read state from disk: %s", err))
+		resp.WriteError(code, err)
 		return
 	}
 
-	resp.WriteAsJson(r)
-}
-
-func (c *ApiCommand) refresh(req *restful.Request, resp *restful.Response) {
-	f, code, err := c.createFiles(req)
+	f, code, err := c.createFiles(req, workspace)
 	if err != nil {
+		c.unlockWorkspace(workspace, lockID)
 		resp.WriteError(code, err)
 		return
 	}
 
-	defer os.RemoveAll(f.tempDir)
-
 	// Set the arguments to be passed to the command
 	args := []string{
 		"-backup=-",
 		"-input=false",
 		"-no-color",
 		"-state=" + f.stateFile,
-		f.tempDir,
 	}
+	args = append(args, f.varArgs...)
+	args = append(args, f.tempDir)
 
-	outputs := NewApiUi()
-	cmd := &command.RefreshCommand{
-		Meta: c.apiMeta(c.Meta, outputs),
+	cleanup := func() {
+		os.RemoveAll(f.tempDir)
+		c.unlockWorkspace(workspace, lockID)
 	}
 
-	r := c.processResults(cmd.Run(args), outputs)
+	job := c.jobs.Submit("refresh", ScopeRefresh, cleanup, func(ctx context.Context, ui *StreamingUi) *Response {
+		renewDone := make(chan struct{})
+		defer close(renewDone)
+		go c.renewLock(workspace, lockID, renewDone)
+
+		cmd := &command.RefreshCommand{
+			Meta: c.apiMeta(c.Meta, ui),
+		}
+
+		r := c.processResults(cmd.Run(args), ui)
+		c.saveState(r, workspace, f.stateFile)
+		return r
+	})
 
-	r.State, err = ioutil.ReadFile(f.stateFile)
+	c.writeJobRef(req, resp, job)
+}
+
+// saveState reads the state a command wrote to stateFile, attaches it to
+// r and, when a StateBackend is configured, persists it under workspace
+// so the next request for that workspace doesn't need to carry it.
+func (c *ApiCommand) saveState(r *Response, workspace, stateFile string) {
+	state, err := ioutil.ReadFile(stateFile)
 	if err != nil {
-		resp.WriteError(http.StatusInternalServerError,
-			fmt.Errorf("Failed to read state from disk: %s", err))
+		failResult(r, "Failed to read state from disk: %s", err)
+		return
+	}
+	r.State = state
+	payloadBytes.WithLabelValues("state", "write").Add(float64(len(state)))
+
+	if c.stateBackend != nil {
+		if err := c.stateBackend.Save(workspace, state); err != nil {
+			failResult(r, "Failed to save state to backend: %s", err)
+		}
+	}
+}
+
+// writeJobRef responds 202 Accepted with the id of a freshly submitted
+// job, pointing the caller at GET /jobs/{id} to follow its progress.
+func (c *ApiCommand) writeJobRef(req *restful.Request, resp *restful.Response, job *Job) {
+	req.SetAttribute("job_id", job.ID)
+	resp.AddHeader("Location", "/jobs/"+job.ID)
+	resp.WriteHeaderAndJson(http.StatusAccepted, &JobRef{JobID: job.ID}, restful.MIME_JSON)
+}
+
+func (c *ApiCommand) jobList(req *restful.Request, resp *restful.Response) {
+	resp.WriteAsJson(c.jobs.List())
+}
+
+func (c *ApiCommand) jobGet(req *restful.Request, resp *restful.Response) {
+	job, ok := c.jobs.Get(req.PathParameter("id"))
+	if !ok {
+		resp.WriteErrorString(http.StatusNotFound, "Unknown job")
+		return
+	}
+	req.SetAttribute("job_id", job.ID)
+	if job.Response != nil {
+		req.SetAttribute("exit_code", job.Response.ExitCode)
+	}
+	resp.WriteAsJson(job)
+}
+
+func (c *ApiCommand) jobCancel(req *restful.Request, resp *restful.Response) {
+	if err := c.jobs.Cancel(req.PathParameter("id")); err != nil {
+		resp.WriteErrorString(http.StatusNotFound, err.Error())
+		return
+	}
+	resp.WriteHeader(http.StatusAccepted)
+}
+
+// jobLogs streams a job's Ui output as Server-Sent Events, replaying
+// anything already produced before following the job live until it
+// finishes or the client disconnects.
+func (c *ApiCommand) jobLogs(req *restful.Request, resp *restful.Response) {
+	job, ok := c.jobs.Get(req.PathParameter("id"))
+	if !ok {
+		resp.WriteErrorString(http.StatusNotFound, "Unknown job")
+		return
+	}
+
+	flusher, ok := resp.ResponseWriter.(http.Flusher)
+	if !ok {
+		resp.WriteErrorString(http.StatusInternalServerError, "Streaming not supported")
 		return
 	}
 
-	resp.WriteAsJson(r)
+	lines, unsubscribe := job.ui.logs.subscribe()
+	defer unsubscribe()
+
+	header := resp.ResponseWriter.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	resp.ResponseWriter.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	notify := req.Request.Context().Done()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(line)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(resp.ResponseWriter, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-notify:
+			return
+		}
+	}
 }
 
-func (c *ApiCommand) createFiles(req *restful.Request) (f *files, code int, err error) {
+func (c *ApiCommand) createFiles(req *restful.Request, workspace string) (f *files, code int, err error) {
 	// Decode the request body to get the required info
 	var r Request
 	err = req.ReadEntity(&r)
@@ -227,8 +573,14 @@ func (c *ApiCommand) createFiles(req *restful.Request) (f *files, code int, err
 		}
 	}()
 
-	// Check if we have a config and if so create the config file
-	if len(r.Config) > 0 {
+	// A Bundle takes priority over a single-file Config, since it can
+	// express everything Config can plus multi-file modules, provider
+	// lock files and so on.
+	if len(r.Bundle) > 0 {
+		if err = extractBundle(f.tempDir, r.Bundle, c.MaxBundleBytes); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+	} else if len(r.Config) > 0 {
 		f.configFile = filepath.Join(f.tempDir, CONFIGFILE)
 		err = c.writeFile(f.configFile, bytes.NewReader(r.Config))
 		if err != nil {
@@ -237,6 +589,13 @@ func (c *ApiCommand) createFiles(req *restful.Request) (f *files, code int, err
 		}
 	}
 
+	varFileArgs, err := writeVarFiles(filepath.Join(f.tempDir, "varfiles"), r.VarFiles)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	f.varArgs = append(f.varArgs, varFileArgs...)
+	f.varArgs = append(f.varArgs, varArgs(r.Vars)...)
+
 	// Check if a plan is supplied and if so create the plan
 	if len(r.Plan) > 0 {
 		f.planFile = filepath.Join(f.tempDir, PLANFILE)
@@ -245,15 +604,28 @@ func (c *ApiCommand) createFiles(req *restful.Request) (f *files, code int, err
 			return nil, http.StatusBadRequest,
 				fmt.Errorf("Failed to save plan to disk: %s", err)
 		}
+		payloadBytes.WithLabelValues("plan", "read").Add(float64(len(r.Plan)))
+	}
+
+	// In all cases (so even when empty) create the state file. If the
+	// request didn't carry one and a StateBackend is configured, fall
+	// back to whatever that backend last saved for this workspace.
+	state := []byte(r.State)
+	if len(state) == 0 && c.stateBackend != nil {
+		state, err = c.stateBackend.Load(workspace)
+		if err != nil {
+			return nil, http.StatusInternalServerError,
+				fmt.Errorf("Failed to load state from backend: %s", err)
+		}
 	}
 
-	// In all cases (so even when empty) create the state file
 	f.stateFile = filepath.Join(f.tempDir, STATEFILE)
-	err = c.writeFile(f.stateFile, bytes.NewReader(r.State))
+	err = c.writeFile(f.stateFile, bytes.NewReader(state))
 	if err != nil {
 		return nil, http.StatusBadRequest,
 			fmt.Errorf("Failed to save state to disk: %s", err)
 	}
+	payloadBytes.WithLabelValues("state", "read").Add(float64(len(state)))
 
 	return f, http.StatusOK, nil
 }
@@ -274,42 +646,9 @@ func (c *ApiCommand) writeFile(filePath string, content io.Reader) error {
 	return nil
 }
 
-type ApiUi struct {
-	AskBuffer    *bytes.Buffer
-	InfoBuffer   *bytes.Buffer
-	OutputBuffer *bytes.Buffer
-	ErrorBuffer  *bytes.Buffer
-}
-
-func NewApiUi() *ApiUi {
-	return &ApiUi{
-		AskBuffer:    new(bytes.Buffer),
-		InfoBuffer:   new(bytes.Buffer),
-		OutputBuffer: new(bytes.Buffer),
-		ErrorBuffer:  new(bytes.Buffer),
-	}
-}
-
-func (u *ApiUi) Ask(query string) (string, error) {
-	u.AskBuffer.WriteString(query)
-	return "", nil
-}
-
-func (u *ApiUi) Info(message string) {
-	u.InfoBuffer.WriteString(message)
-}
-
-func (u *ApiUi) Output(message string) {
-	u.OutputBuffer.WriteString(message)
-}
-
-func (u *ApiUi) Error(message string) {
-	u.ErrorBuffer.WriteString(message)
-}
-
 // In order to catch the native output, we need to create a custom Meta
 // instance that a redirects any output
-func (c *ApiCommand) apiMeta(m command.Meta, ui *ApiUi) command.Meta {
+func (c *ApiCommand) apiMeta(m command.Meta, ui *StreamingUi) command.Meta {
 	return command.Meta{
 		Color:       m.Color,
 		ContextOpts: m.ContextOpts,
@@ -317,7 +656,7 @@ func (c *ApiCommand) apiMeta(m command.Meta, ui *ApiUi) command.Meta {
 	}
 }
 
-func (c *ApiCommand) processResults(exitCode int, outputs *ApiUi) *Response {
+func (c *ApiCommand) processResults(exitCode int, outputs *StreamingUi) *Response {
 	return &Response{
 		Ask:      outputs.AskBuffer.String(),
 		Info:     outputs.InfoBuffer.String(),
@@ -326,3 +665,19 @@ func (c *ApiCommand) processResults(exitCode int, outputs *ApiUi) *Response {
 		ExitCode: exitCode,
 	}
 }
+
+// failResult records a post-processing failure (one that happens after
+// the underlying Terraform command has already run) onto a job's
+// Response, without discarding whatever output the command itself
+// produced.
+func failResult(r *Response, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if r.Error == "" {
+		r.Error = msg
+	} else {
+		r.Error = r.Error + "\n" + msg
+	}
+	if r.ExitCode == 0 {
+		r.ExitCode = 1
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/emicklei/go-restful"
+)
+
+// shutdownCoordinator tracks whether the server has begun shutting down,
+// so readyz can start returning 503 and load balancers can stop routing
+// new requests while the jobs already running are given a chance to
+// finish (see JobStore.Wait, which startApi's shutdown goroutine actually
+// waits on).
+type shutdownCoordinator struct {
+	mu       sync.Mutex
+	draining bool
+}
+
+func newShutdownCoordinator() *shutdownCoordinator {
+	return &shutdownCoordinator{}
+}
+
+// beginDraining marks the server as shutting down.
+func (s *shutdownCoordinator) beginDraining() {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+}
+
+func (s *shutdownCoordinator) isDraining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draining
+}
+
+// healthz is a liveness endpoint: as long as the process can answer HTTP
+// requests at all, it reports ok.
+func (c *ApiCommand) healthz(req *restful.Request, resp *restful.Response) {
+	resp.WriteHeader(http.StatusOK)
+}
+
+// readyz is a readiness endpoint: it reports ok until shutdown begins, so
+// a load balancer can stop routing new requests to a draining instance.
+func (c *ApiCommand) readyz(req *restful.Request, resp *restful.Response) {
+	if c.shutdown.isDraining() {
+		resp.WriteErrorString(http.StatusServiceUnavailable, "shutting down")
+		return
+	}
+	resp.WriteHeader(http.StatusOK)
+}
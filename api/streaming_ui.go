@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// logLine is a single piece of Ui output captured while a job runs. Stream
+// identifies which of the four Ui methods produced it, mirroring the
+// fields ApiUi used to buffer separately.
+type logLine struct {
+	Stream  string    `json:"stream"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// logBroadcaster fans the log lines produced by a single job out to any
+// number of subscribers, such as concurrent GET /jobs/{id}/logs callers.
+// A subscriber that joins after the job has produced output is replayed
+// everything seen so far before receiving live lines.
+type logBroadcaster struct {
+	mu     sync.Mutex
+	lines  []logLine
+	subs   map[chan logLine]struct{}
+	closed bool
+}
+
+func newLogBroadcaster() *logBroadcaster {
+	return &logBroadcaster{
+		subs: make(map[chan logLine]struct{}),
+	}
+}
+
+func (b *logBroadcaster) publish(stream, message string) {
+	line := logLine{Stream: stream, Message: message, Time: time.Now()}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	b.lines = append(b.lines, line)
+	for ch := range b.subs {
+		select {
+		case ch <- line:
+		default:
+			// A slow subscriber doesn't get to block the job; it can
+			// rely on the replay buffer if it falls behind.
+		}
+	}
+}
+
+// subscribe returns a channel of log lines, starting with a replay of
+// everything published so far, and an unsubscribe function the caller
+// must invoke when it's done reading.
+func (b *logBroadcaster) subscribe() (<-chan logLine, func()) {
+	b.mu.Lock()
+
+	// The channel must be sized to hold the entire replay buffer up
+	// front: publish sends to it while b.mu is held, and a blocking
+	// send there would stall every future publish call, hanging the
+	// job itself rather than just this subscriber.
+	ch := make(chan logLine, len(b.lines)+64)
+	for _, line := range b.lines {
+		ch <- line
+	}
+	closed := b.closed
+	if !closed {
+		b.subs[ch] = struct{}{}
+	}
+	b.mu.Unlock()
+
+	if closed {
+		close(ch)
+	}
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+		b.mu.Unlock()
+	}
+	return ch, unsubscribe
+}
+
+// close marks the broadcaster done and closes every subscriber channel,
+// signaling that no further log lines will be published.
+func (b *logBroadcaster) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for ch := range b.subs {
+		close(ch)
+	}
+	b.subs = nil
+}
+
+// StreamingUi is a cli.Ui implementation that publishes each line to a
+// logBroadcaster as it is produced, instead of buffering everything until
+// the command finishes like ApiUi did. The buffers are retained so the
+// final Response can still be populated exactly as before.
+type StreamingUi struct {
+	AskBuffer    *bytes.Buffer
+	InfoBuffer   *bytes.Buffer
+	OutputBuffer *bytes.Buffer
+	ErrorBuffer  *bytes.Buffer
+
+	logs *logBroadcaster
+}
+
+func NewStreamingUi() *StreamingUi {
+	return &StreamingUi{
+		AskBuffer:    new(bytes.Buffer),
+		InfoBuffer:   new(bytes.Buffer),
+		OutputBuffer: new(bytes.Buffer),
+		ErrorBuffer:  new(bytes.Buffer),
+		logs:         newLogBroadcaster(),
+	}
+}
+
+func (u *StreamingUi) Ask(query string) (string, error) {
+	u.AskBuffer.WriteString(query)
+	u.logs.publish("ask", query)
+	return "", nil
+}
+
+func (u *StreamingUi) Info(message string) {
+	u.InfoBuffer.WriteString(message)
+	u.logs.publish("info", message)
+}
+
+func (u *StreamingUi) Output(message string) {
+	u.OutputBuffer.WriteString(message)
+	u.logs.publish("output", message)
+}
+
+func (u *StreamingUi) Error(message string) {
+	u.ErrorBuffer.WriteString(message)
+	u.logs.publish("error", message)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestLogBroadcasterSubscribeDoesNotBlockPublish guards against a
+// regression where subscribe sent the entire replay buffer to a
+// subscriber's channel while holding b.mu: once more lines had been
+// published than the channel's buffer could hold, that send blocked
+// forever with the lock held, wedging every subsequent publish call (and
+// so the Terraform command running synchronously on the other end of
+// it).
+func TestLogBroadcasterSubscribeDoesNotBlockPublish(t *testing.T) {
+	b := newLogBroadcaster()
+
+	for i := 0; i < 200; i++ {
+		b.publish("output", fmt.Sprintf("line %d", i))
+	}
+
+	ch, unsubscribe := b.subscribe()
+	defer unsubscribe()
+
+	done := make(chan struct{})
+	go func() {
+		b.publish("output", "line after subscribe")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("publish after subscribe did not return: subscribe is holding the lock on a blocked send")
+	}
+
+	// Drain the channel so a slow test runner doesn't also deadlock on
+	// an unbuffered reader; the regression this guards against makes it
+	// unnecessary to read from ch at all for the test to hang.
+	count := 0
+	for range ch {
+		count++
+		if count == 201 {
+			break
+		}
+	}
+}
+
+func TestLogBroadcasterReplaysBufferedLines(t *testing.T) {
+	b := newLogBroadcaster()
+	b.publish("info", "first")
+	b.publish("output", "second")
+
+	ch, unsubscribe := b.subscribe()
+	defer unsubscribe()
+
+	first := <-ch
+	if first.Message != "first" {
+		t.Errorf("first replayed line = %q, want %q", first.Message, "first")
+	}
+	second := <-ch
+	if second.Message != "second" {
+		t.Errorf("second replayed line = %q, want %q", second.Message, "second")
+	}
+}
+
+func TestLogBroadcasterSubscribeAfterCloseIsClosedChannel(t *testing.T) {
+	b := newLogBroadcaster()
+	b.publish("info", "before close")
+	b.close()
+
+	ch, unsubscribe := b.subscribe()
+	defer unsubscribe()
+
+	line, ok := <-ch
+	if !ok {
+		t.Fatal("expected the replay buffer to be delivered before the channel closes")
+	}
+	if line.Message != "before close" {
+		t.Errorf("replayed line = %q, want %q", line.Message, "before close")
+	}
+
+	if _, ok := <-ch; ok {
+		t.Error("expected channel to be closed after replay for a closed broadcaster")
+	}
+}